@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+var validEvents = map[string]bool{
+	"join":    true,
+	"leave":   true,
+	"mute":    true,
+	"unmute":  true,
+	"talking": true,
+}
+
+// confEvent is the JSON body accepted by /v1/event.
+type confEvent struct {
+	Conference string    `json:"conference"`
+	CLID       string    `json:"clid"`
+	Event      string    `json:"event"`
+	Timestamp  time.Time `json:"timestamp"`
+}
+
+// eventTemplateData is what a conference's message template is rendered
+// against.
+type eventTemplateData struct {
+	CLID       string
+	Conference string
+	Event      string
+	Timestamp  time.Time
+}
+
+func checkAuth(r *http.Request, pw passwd) bool {
+	u, p, authPresent := r.BasicAuth()
+	if !authPresent || u != pw.User {
+		return false
+	}
+	return bcrypt.CompareHashAndPassword([]byte(pw.Hash), []byte(p)) == nil
+}
+
+// wrapLegacyAPIHandler is the original form-encoded, single-channel
+// announcement endpoint, kept at /v1/legacy for the existing Asterisk
+// dialplan snippet below. It always announces over n, the "irc" backend,
+// since that's what the legacy dialplan integration expects.
+func wrapLegacyAPIHandler(n Notifier, pw passwd) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		// from Asterisk dialplan:
+		// exten => 1000,1,Set(CURLOPT(userpwd)=some_username:some_password)
+		// exten => 1000,n,NoOp(${CURL(https://confann.example.org/v1/legacy,CLID=${CALLERID(num)}})
+		// exten => 1000,n,ConfBridge("someconference")
+
+		if !checkAuth(r, pw) {
+			log.Printf("401: %s", r.URL.RequestURI())
+			http.Error(w, "401", http.StatusUnauthorized)
+			return
+		}
+
+		if r.Method != "POST" {
+			log.Printf("404: %s", r.URL.RequestURI())
+			http.Error(w, "404", http.StatusNotFound)
+			return
+		}
+		err := r.ParseForm()
+		if err != nil {
+			log.Printf("error parsing request form: %v", err)
+			http.Error(w, "400", http.StatusBadRequest)
+			return
+		}
+		var post []string
+		var clid string
+		var ok bool
+		if post, ok = r.PostForm["CLID"]; ok {
+			log.Printf("API: %v from %s", post, r.RemoteAddr)
+			if len(post) > 0 {
+				clid = post[0]
+			} else {
+				clid = "<< anonymous caller >>"
+			}
+		} else {
+			log.Printf("API: insufficient PostForm: %v", r.PostForm)
+			http.Error(w, "400", http.StatusBadRequest)
+			return
+		}
+		notice := fmt.Sprintf("%s joined the conference.", clid)
+
+		if !n.Ready() {
+			log.Print("API: irc not connected yet")
+			http.Error(w, "503: irc disconnected", http.StatusServiceUnavailable)
+			return
+		}
+		if err := n.Notify(r.Context(), channel, notice); err != nil {
+			log.Printf("error sending notice: %v", err)
+			http.Error(w, "502", http.StatusBadGateway)
+			return
+		}
+	}
+}
+
+// wrapEventAPIHandler is the structured JSON conference-bridge
+// announcement endpoint at /v1/event. It routes each event to the
+// channels and backends configured for its conference in
+// ~/.confann/conferences.json and renders the announcement through
+// that conference's template.
+func wrapEventAPIHandler(backends map[string]Notifier, pw passwd, routes map[string]conferenceRoute, track *conferenceTracker) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !checkAuth(r, pw) {
+			log.Printf("401: %s", r.URL.RequestURI())
+			http.Error(w, "401", http.StatusUnauthorized)
+			return
+		}
+
+		if r.Method != "POST" {
+			log.Printf("404: %s", r.URL.RequestURI())
+			http.Error(w, "404", http.StatusNotFound)
+			return
+		}
+
+		var ev confEvent
+		if err := json.NewDecoder(r.Body).Decode(&ev); err != nil {
+			log.Printf("error decoding event body: %v", err)
+			http.Error(w, "400", http.StatusBadRequest)
+			return
+		}
+		if ev.Conference == "" || ev.CLID == "" || !validEvents[ev.Event] {
+			log.Printf("API: malformed event: %+v", ev)
+			http.Error(w, "400", http.StatusBadRequest)
+			return
+		}
+		log.Printf("API: %+v from %s", ev, r.RemoteAddr)
+
+		route, ok := routes[ev.Conference]
+		if !ok {
+			log.Printf("API: unconfigured conference %q", ev.Conference)
+			http.Error(w, "404", http.StatusNotFound)
+			return
+		}
+		track.apply(ev)
+
+		if track.isSilenced(ev.Conference) {
+			log.Printf("API: %q is silenced, suppressing announcement", ev.Conference)
+			return
+		}
+
+		var buf bytes.Buffer
+		data := eventTemplateData{
+			CLID:       ev.CLID,
+			Conference: ev.Conference,
+			Event:      ev.Event,
+			Timestamp:  ev.Timestamp,
+		}
+		if err := route.Template.Execute(&buf, data); err != nil {
+			log.Printf("error executing template for %q: %v", ev.Conference, err)
+			http.Error(w, "500", http.StatusInternalServerError)
+			return
+		}
+		notice := buf.String()
+
+		sent := 0
+		for _, backendName := range route.Backends {
+			n, ok := backends[backendName]
+			if !ok {
+				log.Printf("API: conference %q names unknown backend %q", ev.Conference, backendName)
+				continue
+			}
+			if !n.Ready() {
+				log.Printf("API: backend %q not ready", backendName)
+				continue
+			}
+			for _, ch := range route.Channels {
+				if err := n.Notify(r.Context(), ch, notice); err != nil {
+					log.Printf("error sending notice via %q to %q: %v", backendName, ch, err)
+					continue
+				}
+				sent++
+			}
+		}
+		if sent == 0 {
+			http.Error(w, "502", http.StatusBadGateway)
+		}
+	}
+}
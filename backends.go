@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+func parseBackendList(s string) []string {
+	var names []string
+	for _, n := range strings.Split(s, ",") {
+		n = strings.TrimSpace(n)
+		if n != "" {
+			names = append(names, n)
+		}
+	}
+	return names
+}
+
+// buildBackends instantiates the Notifier for each requested backend
+// name. ircBackend is supplied by the caller since its construction
+// depends on whether we're in -standalone mode.
+func buildBackends(names []string, ircBackend Notifier) (map[string]Notifier, error) {
+	backends := make(map[string]Notifier, len(names))
+	for _, name := range names {
+		switch name {
+		case "irc":
+			backends["irc"] = ircBackend
+		case "matrix":
+			token, err := loadMatrixSecret()
+			if err != nil {
+				return nil, fmt.Errorf("matrix backend: %w", err)
+			}
+			backends["matrix"] = newMatrixNotifier(matrixHomeserver, token)
+		case "slack":
+			webhook, err := loadSlackWebhookURL()
+			if err != nil {
+				return nil, fmt.Errorf("slack backend: %w", err)
+			}
+			backends["slack"] = newSlackNotifier(webhook)
+		default:
+			return nil, fmt.Errorf("unknown backend %q", name)
+		}
+	}
+	return backends, nil
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"math/rand"
+	"time"
+)
+
+const (
+	minReconnectDelay = 5 * time.Second
+	maxReconnectDelay = 5 * time.Minute
+)
+
+// backoffDelay returns the delay before reconnect attempt n (0-indexed),
+// doubling from minReconnectDelay up to maxReconnectDelay and adding up
+// to 20% jitter so a netsplit doesn't send every bot back in lockstep.
+func backoffDelay(attempt int) time.Duration {
+	delay := minReconnectDelay
+	for i := 0; i < attempt; i++ {
+		delay *= 2
+		if delay >= maxReconnectDelay {
+			delay = maxReconnectDelay
+			break
+		}
+	}
+	jitter := time.Duration(rand.Int63n(int64(delay)/5 + 1))
+	return delay + jitter
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	irc "github.com/fluffle/goirc/client"
+)
+
+type commandFunc func(conn *irc.Conn, track *conferenceTracker, target, nick string, args []string)
+
+var commands = map[string]commandFunc{
+	"!botlist":     cmdBotlist,
+	"!conferences": cmdConferences,
+	"!who":         cmdWho,
+	"!silence":     cmdSilence,
+	"!help":        cmdHelp,
+}
+
+// privilegedCommands require the caller to be a channel op, checked via
+// goirc's state tracking.
+var privilegedCommands = map[string]bool{
+	"!silence": true,
+}
+
+func cmdBotlist(conn *irc.Conn, track *conferenceTracker, target, nick string, args []string) {
+	conn.Privmsg(target, botMessage)
+}
+
+func cmdConferences(conn *irc.Conn, track *conferenceTracker, target, nick string, args []string) {
+	names := track.conferences()
+	if len(names) == 0 {
+		conn.Privmsg(target, "no active conferences")
+		return
+	}
+	parts := make([]string, 0, len(names))
+	for _, name := range names {
+		parts = append(parts, fmt.Sprintf("%s (%d)", name, track.occupantCount(name)))
+	}
+	conn.Privmsg(target, strings.Join(parts, ", "))
+}
+
+func cmdWho(conn *irc.Conn, track *conferenceTracker, target, nick string, args []string) {
+	if len(args) < 1 {
+		conn.Privmsg(target, "usage: !who <conference>")
+		return
+	}
+	clids := track.occupantCLIDs(args[0])
+	if len(clids) == 0 {
+		conn.Privmsg(target, fmt.Sprintf("%s is empty", args[0]))
+		return
+	}
+	conn.Privmsg(target, strings.Join(clids, ", "))
+}
+
+func cmdSilence(conn *irc.Conn, track *conferenceTracker, target, nick string, args []string) {
+	if len(args) < 2 {
+		conn.Privmsg(target, "usage: !silence <conference> <duration>")
+		return
+	}
+	d, err := time.ParseDuration(args[1])
+	if err != nil {
+		conn.Privmsg(target, fmt.Sprintf("bad duration %q: %v", args[1], err))
+		return
+	}
+	track.silence(args[0], d)
+	conn.Privmsg(target, fmt.Sprintf("silencing %s for %s", args[0], d))
+}
+
+func cmdHelp(conn *irc.Conn, track *conferenceTracker, target, nick string, args []string) {
+	conn.Privmsg(target, "commands: !botlist, !conferences, !who <conference>, !silence <conference> <duration> (ops only), !help")
+}
+
+// isChanOp reports whether nick holds op in channel, per goirc's state
+// tracker. Requires conn.EnableStateTracking() to have been called.
+func isChanOp(conn *irc.Conn, channelName, nick string) bool {
+	st := conn.StateTracker()
+	if st == nil {
+		return false
+	}
+	n := st.GetNick(nick)
+	if n == nil {
+		return false
+	}
+	cp, ok := n.IsOn(channelName)
+	if !ok {
+		return false
+	}
+	return cp.Op
+}
+
+// dispatchCommand handles a "!"-prefixed PRIVMSG, gating privileged
+// commands to channel ops.
+func dispatchCommand(conn *irc.Conn, track *conferenceTracker, line *irc.Line) {
+	if len(line.Args) < 2 {
+		return
+	}
+	target, text := line.Args[0], line.Args[1]
+	if !strings.HasPrefix(text, "!") {
+		return
+	}
+	fields := strings.Fields(text)
+	name := fields[0]
+	args := fields[1:]
+
+	fn, ok := commands[name]
+	if !ok {
+		return
+	}
+	log.Printf("command %s %v from %s in %s", name, args, line.Nick, target)
+	// a PRIVMSG sent directly to the bot (not to a channel) carries the
+	// bot's own nick as target; reply to the sender instead.
+	if !strings.HasPrefix(target, "#") && !strings.HasPrefix(target, "&") {
+		target = line.Nick
+	}
+	if privilegedCommands[name] && !isChanOp(conn, target, line.Nick) {
+		conn.Privmsg(target, "that command requires channel op")
+		return
+	}
+	fn(conn, track, target, line.Nick, args)
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"text/template"
+)
+
+const defaultEventTemplate = `{{.CLID}} {{.Event}} {{.Conference}}.`
+
+// conferenceConfig is the on-disk shape of a single conference entry in
+// ~/.confann/conferences.json: which channels it announces to (each one
+// passed to every backend of the conference: an IRC channel, a Matrix
+// room ID, or a Slack channel), an
+// optional custom text/template for the announcement message, and which
+// notification backends carry it (defaulting to every active -backends
+// entry when omitted).
+type conferenceConfig struct {
+	Channels []string `json:"channels"`
+	Template string   `json:"template"`
+	Backends []string `json:"backends"`
+}
+
+type conferencesFile struct {
+	Conferences map[string]conferenceConfig `json:"conferences"`
+}
+
+// conferenceRoute is the resolved, ready-to-use form of a
+// conferenceConfig: channels plus its parsed template and backend list,
+// defaulted when not given.
+type conferenceRoute struct {
+	Channels []string
+	Template *template.Template
+	Backends []string
+}
+
+func loadConferences(defaultBackends []string) (map[string]conferenceRoute, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil, err
+	}
+	fqp := path.Join(home, confDir, "conferences.json")
+	data, err := ioutil.ReadFile(fqp)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return map[string]conferenceRoute{}, nil
+		}
+		return nil, err
+	}
+	return parseConferences(data, defaultBackends)
+}
+
+func parseConferences(data []byte, defaultBackends []string) (map[string]conferenceRoute, error) {
+	var cf conferencesFile
+	if err := json.Unmarshal(data, &cf); err != nil {
+		return nil, err
+	}
+	routes := make(map[string]conferenceRoute, len(cf.Conferences))
+	for name, cc := range cf.Conferences {
+		tmplSrc := cc.Template
+		if tmplSrc == "" {
+			tmplSrc = defaultEventTemplate
+		}
+		tmpl, err := template.New(name).Parse(tmplSrc)
+		if err != nil {
+			return nil, fmt.Errorf("conference %q: %w", name, err)
+		}
+		backends := cc.Backends
+		if len(backends) == 0 {
+			backends = defaultBackends
+		}
+		routes[name] = conferenceRoute{Channels: cc.Channels, Template: tmpl, Backends: backends}
+	}
+	return routes, nil
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"log"
+	"time"
+
+	irc "github.com/fluffle/goirc/client"
+)
+
+const confannVersion = "0.2"
+
+// ctcpReplyBody returns the body to answer a CTCP command with, and
+// whether it's one we answer ourselves at all. VERSION and PING are
+// deliberately absent: goirc's built-in CTCP handler already answers
+// those (VERSION using cfg.Version, set in buildIRCConfig), and
+// answering them again here would double-reply.
+func ctcpReplyBody(cmd string) (body string, ok bool) {
+	switch cmd {
+	case "TIME":
+		return time.Now().Format(time.RFC1123), true
+	case "SOURCE":
+		return "https://github.com/alrs/confann", true
+	case "USERINFO":
+		return "confann, an IRC bot to announce Asterisk conference joins", true
+	default:
+		return "", false
+	}
+}
+
+// handleCTCP answers the CTCP requests goirc doesn't already handle
+// internally. goirc's line parser rewrites any \001-wrapped
+// PRIVMSG/NOTICE into its own CTCP/CTCPREPLY event before dispatch ever
+// runs, with the CTCP command in line.Args[0].
+func handleCTCP(conn *irc.Conn, line *irc.Line) {
+	if len(line.Args) < 1 {
+		return
+	}
+	cmd := line.Args[0]
+	body, ok := ctcpReplyBody(cmd)
+	if !ok {
+		return
+	}
+	conn.CtcpReply(line.Nick, cmd, body)
+	log.Printf("CTCP %s from %s", cmd, line.Nick)
+}
@@ -0,0 +1,22 @@
+package main
+
+import "testing"
+
+func TestCtcpReplyBody(t *testing.T) {
+	for _, cmd := range []string{"TIME", "SOURCE", "USERINFO"} {
+		if body, ok := ctcpReplyBody(cmd); !ok || body == "" {
+			t.Errorf("ctcpReplyBody(%q) = %q, %v; want a non-empty reply", cmd, body, ok)
+		}
+	}
+}
+
+// TestCtcpReplyBodySkipsLibraryHandled confirms VERSION and PING stay
+// unhandled here: goirc's own internal CTCP handler answers those, and
+// replying to them again here would double-reply on the wire.
+func TestCtcpReplyBodySkipsLibraryHandled(t *testing.T) {
+	for _, cmd := range []string{"VERSION", "PING", "UNKNOWN"} {
+		if _, ok := ctcpReplyBody(cmd); ok {
+			t.Errorf("ctcpReplyBody(%q) = ok, want unhandled", cmd)
+		}
+	}
+}
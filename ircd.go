@@ -0,0 +1,541 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Minimal RFC 2812 numeric replies, just enough for the commands this
+// embedded ircd understands.
+const (
+	rplWelcome          = "001"
+	rplYourHost         = "002"
+	rplCreated          = "003"
+	rplMyInfo           = "004"
+	rplNoTopic          = "331"
+	rplTopic            = "332"
+	rplNamReply         = "353"
+	rplEndOfNames       = "366"
+	rplWhoReply         = "352"
+	rplEndOfWho         = "315"
+	errNoSuchChannel    = "403"
+	errNotRegistered    = "451"
+	errNicknameInUse    = "433"
+	errNeedMoreParams   = "461"
+	errAlreadyRegistred = "462"
+)
+
+const ircLineLimit = 512
+
+// ircdClient is one connected socket. Writes are serialized with a
+// mutex since broadcasts from other goroutines can race a client's own
+// replies.
+type ircdClient struct {
+	conn       net.Conn
+	mu         sync.Mutex
+	nick       string
+	user       string
+	real       string
+	registered bool
+}
+
+func (c *ircdClient) send(line string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	fmt.Fprintf(c.conn, "%s\r\n", line)
+}
+
+func (c *ircdClient) prefix() string {
+	return fmt.Sprintf("%s!%s@confann", c.nick, c.user)
+}
+
+// ircdChannel is a joined-to channel and its members.
+type ircdChannel struct {
+	name    string
+	topic   string
+	members map[string]*ircdClient
+}
+
+// ircd is the embedded standalone server: an in-memory client/channel
+// state model guarded by a single mutex, per the -standalone request.
+type ircd struct {
+	mu         sync.Mutex
+	serverName string
+	created    time.Time
+	clients    map[string]*ircdClient
+	channels   map[string]*ircdChannel
+}
+
+func newIRCD(serverName string) *ircd {
+	return &ircd{
+		serverName: serverName,
+		created:    time.Now(),
+		clients:    make(map[string]*ircdClient),
+		channels:   make(map[string]*ircdChannel),
+	}
+}
+
+// Ready always reports true once the ircd goroutine is running: unlike
+// the goirc backend there's no outbound dial that can be down.
+func (d *ircd) Ready() bool {
+	return true
+}
+
+// Notify implements Notifier by publishing directly into the embedded
+// server's channel state, bypassing goirc entirely.
+func (d *ircd) Notify(ctx context.Context, channelName, msg string) error {
+	d.mu.Lock()
+	ch, ok := d.channels[channelName]
+	d.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("no such channel: %s", channelName)
+	}
+	d.broadcast(ch, fmt.Sprintf(":%s NOTICE %s :%s", d.serverName, channelName, msg), nil)
+	return nil
+}
+
+func (d *ircd) broadcast(ch *ircdChannel, line string, exclude *ircdClient) {
+	d.mu.Lock()
+	members := make([]*ircdClient, 0, len(ch.members))
+	for _, m := range ch.members {
+		if m != exclude {
+			members = append(members, m)
+		}
+	}
+	d.mu.Unlock()
+	for _, m := range members {
+		m.send(line)
+	}
+}
+
+func (d *ircd) numeric(c *ircdClient, code, rest string) {
+	nick := c.nick
+	if nick == "" {
+		nick = "*"
+	}
+	c.send(fmt.Sprintf(":%s %s %s %s", d.serverName, code, nick, rest))
+}
+
+func (d *ircd) listenAndServeTLS(addr string, tlsConfig *tls.Config) error {
+	ln, err := tls.Listen("tcp", addr, tlsConfig)
+	if err != nil {
+		return err
+	}
+	log.Printf("standalone ircd listening on %s", addr)
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			log.Printf("ircd accept: %v", err)
+			continue
+		}
+		go d.handleConn(conn)
+	}
+}
+
+func (d *ircd) handleConn(conn net.Conn) {
+	c := &ircdClient{conn: conn}
+	defer d.quit(c, "connection closed")
+
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, ircLineLimit), ircLineLimit)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if line == "" {
+			continue
+		}
+		d.dispatch(c, line)
+	}
+}
+
+// parseLine splits a raw IRC line into its command and params, honoring
+// the ":trailing param with spaces" convention.
+func parseLine(line string) (cmd string, params []string) {
+	trailing := ""
+	hasTrailing := false
+	if idx := strings.Index(line, " :"); idx >= 0 {
+		trailing = line[idx+2:]
+		hasTrailing = true
+		line = line[:idx]
+	}
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return "", nil
+	}
+	cmd = strings.ToUpper(fields[0])
+	params = fields[1:]
+	if hasTrailing {
+		params = append(params, trailing)
+	}
+	return cmd, params
+}
+
+// requiresRegistration lists commands that need a fully registered
+// client (NICK and USER both set), rejected with ERR_NOTREGISTERED
+// otherwise so an unregistered connection can't join channels or send
+// messages under an empty nick.
+var requiresRegistration = map[string]bool{
+	"JOIN":    true,
+	"PART":    true,
+	"PRIVMSG": true,
+	"NOTICE":  true,
+	"MODE":    true,
+	"NAMES":   true,
+	"WHO":     true,
+	"TOPIC":   true,
+}
+
+func (d *ircd) dispatch(c *ircdClient, line string) {
+	cmd, params := parseLine(line)
+	if requiresRegistration[cmd] && !c.registered {
+		d.numeric(c, errNotRegistered, ":You have not registered")
+		return
+	}
+	switch cmd {
+	case "NICK":
+		d.handleNick(c, params)
+	case "USER":
+		d.handleUser(c, params)
+	case "PING":
+		d.handlePing(c, params)
+	case "PONG":
+		// no-op: we don't send PINGs to clients yet
+	case "JOIN":
+		d.handleJoin(c, params)
+	case "PART":
+		d.handlePart(c, params)
+	case "PRIVMSG":
+		d.handleMsg(c, params, "PRIVMSG")
+	case "NOTICE":
+		d.handleMsg(c, params, "NOTICE")
+	case "QUIT":
+		d.quit(c, "Quit")
+	case "MODE":
+		d.handleMode(c, params)
+	case "NAMES":
+		d.handleNames(c, params)
+	case "WHO":
+		d.handleWho(c, params)
+	case "TOPIC":
+		d.handleTopic(c, params)
+	default:
+		log.Printf("ircd: unhandled command %q from %s", cmd, c.nick)
+	}
+}
+
+func (d *ircd) handleNick(c *ircdClient, params []string) {
+	if len(params) < 1 {
+		d.numeric(c, errNeedMoreParams, "NICK :Not enough parameters")
+		return
+	}
+	newNick := params[0]
+
+	d.mu.Lock()
+	if existing, taken := d.clients[newNick]; taken && existing != c {
+		d.mu.Unlock()
+		d.numeric(c, errNicknameInUse, newNick+" :Nickname is already in use")
+		return
+	}
+	old := c.nick
+	if old != "" {
+		delete(d.clients, old)
+	}
+	c.nick = newNick
+	d.clients[c.nick] = c
+	d.mu.Unlock()
+
+	if old != "" {
+		c.send(fmt.Sprintf(":%s!%s@confann NICK :%s", old, c.user, c.nick))
+	}
+	d.maybeRegister(c)
+}
+
+func (d *ircd) handleUser(c *ircdClient, params []string) {
+	if c.registered {
+		d.numeric(c, errAlreadyRegistred, ":Unauthorized command (already registered)")
+		return
+	}
+	if len(params) < 4 {
+		d.numeric(c, errNeedMoreParams, "USER :Not enough parameters")
+		return
+	}
+	c.user = params[0]
+	c.real = params[3]
+	d.maybeRegister(c)
+}
+
+func (d *ircd) maybeRegister(c *ircdClient) {
+	if c.registered || c.nick == "" || c.user == "" {
+		return
+	}
+	c.registered = true
+	d.numeric(c, rplWelcome, fmt.Sprintf(":Welcome to confann, %s", c.prefix()))
+	d.numeric(c, rplYourHost, fmt.Sprintf(":Your host is %s, running confann -standalone", d.serverName))
+	d.numeric(c, rplCreated, fmt.Sprintf(":This server was created %s", d.created.Format(time.RFC1123)))
+	d.numeric(c, rplMyInfo, fmt.Sprintf("%s confann-standalone o o", d.serverName))
+}
+
+func (d *ircd) handlePing(c *ircdClient, params []string) {
+	token := d.serverName
+	if len(params) > 0 {
+		token = params[0]
+	}
+	c.send(fmt.Sprintf("PONG %s :%s", d.serverName, token))
+}
+
+func (d *ircd) handleJoin(c *ircdClient, params []string) {
+	if len(params) < 1 {
+		d.numeric(c, errNeedMoreParams, "JOIN :Not enough parameters")
+		return
+	}
+	for _, name := range strings.Split(params[0], ",") {
+		d.joinChannel(c, name)
+	}
+}
+
+func (d *ircd) joinChannel(c *ircdClient, name string) {
+	d.mu.Lock()
+	ch, ok := d.channels[name]
+	if !ok {
+		ch = &ircdChannel{name: name, members: make(map[string]*ircdClient)}
+		d.channels[name] = ch
+	}
+	ch.members[c.nick] = c
+	d.mu.Unlock()
+
+	d.broadcast(ch, fmt.Sprintf(":%s JOIN %s", c.prefix(), name), nil)
+	if ch.topic != "" {
+		d.numeric(c, rplTopic, fmt.Sprintf("%s :%s", name, ch.topic))
+	} else {
+		d.numeric(c, rplNoTopic, fmt.Sprintf("%s :No topic is set", name))
+	}
+	d.sendNames(c, ch)
+}
+
+func (d *ircd) sendNames(c *ircdClient, ch *ircdChannel) {
+	d.mu.Lock()
+	names := make([]string, 0, len(ch.members))
+	for n := range ch.members {
+		names = append(names, n)
+	}
+	d.mu.Unlock()
+	d.numeric(c, rplNamReply, fmt.Sprintf("= %s :%s", ch.name, strings.Join(names, " ")))
+	d.numeric(c, rplEndOfNames, fmt.Sprintf("%s :End of /NAMES list", ch.name))
+}
+
+func (d *ircd) handlePart(c *ircdClient, params []string) {
+	if len(params) < 1 {
+		d.numeric(c, errNeedMoreParams, "PART :Not enough parameters")
+		return
+	}
+	for _, name := range strings.Split(params[0], ",") {
+		d.mu.Lock()
+		ch, ok := d.channels[name]
+		if ok {
+			delete(ch.members, c.nick)
+		}
+		d.mu.Unlock()
+		if !ok {
+			d.numeric(c, errNoSuchChannel, fmt.Sprintf("%s :No such channel", name))
+			continue
+		}
+		d.broadcast(ch, fmt.Sprintf(":%s PART %s", c.prefix(), name), nil)
+	}
+}
+
+func (d *ircd) handleMsg(c *ircdClient, params []string, verb string) {
+	if len(params) < 2 {
+		d.numeric(c, errNeedMoreParams, verb+" :Not enough parameters")
+		return
+	}
+	target, msg := params[0], params[1]
+	line := fmt.Sprintf(":%s %s %s :%s", c.prefix(), verb, target, msg)
+
+	if strings.HasPrefix(target, "#") {
+		d.mu.Lock()
+		ch, ok := d.channels[target]
+		d.mu.Unlock()
+		if !ok {
+			d.numeric(c, errNoSuchChannel, fmt.Sprintf("%s :No such channel", target))
+			return
+		}
+		d.broadcast(ch, line, c)
+		return
+	}
+
+	d.mu.Lock()
+	to, ok := d.clients[target]
+	d.mu.Unlock()
+	if ok {
+		to.send(line)
+	}
+}
+
+// handleMode is a deliberately minimal stub: it acknowledges mode
+// queries but doesn't implement channel/user modes, since confann
+// doesn't need them to relay announcements.
+func (d *ircd) handleMode(c *ircdClient, params []string) {
+	if len(params) < 1 {
+		d.numeric(c, errNeedMoreParams, "MODE :Not enough parameters")
+		return
+	}
+	if len(params) == 1 {
+		c.send(fmt.Sprintf(":%s MODE %s +", d.serverName, params[0]))
+	}
+}
+
+func (d *ircd) handleNames(c *ircdClient, params []string) {
+	if len(params) < 1 {
+		d.numeric(c, rplEndOfNames, "* :End of /NAMES list")
+		return
+	}
+	for _, name := range strings.Split(params[0], ",") {
+		d.mu.Lock()
+		ch, ok := d.channels[name]
+		d.mu.Unlock()
+		if ok {
+			d.sendNames(c, ch)
+		}
+	}
+}
+
+func (d *ircd) handleWho(c *ircdClient, params []string) {
+	if len(params) < 1 {
+		d.numeric(c, rplEndOfWho, "* :End of /WHO list")
+		return
+	}
+	target := params[0]
+	d.mu.Lock()
+	ch, ok := d.channels[target]
+	var members []*ircdClient
+	if ok {
+		for _, m := range ch.members {
+			members = append(members, m)
+		}
+	}
+	d.mu.Unlock()
+	for _, m := range members {
+		d.numeric(c, rplWhoReply, fmt.Sprintf("%s confann %s %s %s H :0 %s", target, m.user, d.serverName, m.nick, m.real))
+	}
+	d.numeric(c, rplEndOfWho, target+" :End of /WHO list")
+}
+
+func (d *ircd) handleTopic(c *ircdClient, params []string) {
+	if len(params) < 1 {
+		d.numeric(c, errNeedMoreParams, "TOPIC :Not enough parameters")
+		return
+	}
+	name := params[0]
+	d.mu.Lock()
+	ch, ok := d.channels[name]
+	d.mu.Unlock()
+	if !ok {
+		d.numeric(c, errNoSuchChannel, fmt.Sprintf("%s :No such channel", name))
+		return
+	}
+	if len(params) < 2 {
+		if ch.topic == "" {
+			d.numeric(c, rplNoTopic, name+" :No topic is set")
+		} else {
+			d.numeric(c, rplTopic, fmt.Sprintf("%s :%s", name, ch.topic))
+		}
+		return
+	}
+	d.mu.Lock()
+	ch.topic = params[1]
+	d.mu.Unlock()
+	d.broadcast(ch, fmt.Sprintf(":%s TOPIC %s :%s", c.prefix(), name, ch.topic), nil)
+}
+
+func (d *ircd) quit(c *ircdClient, reason string) {
+	d.mu.Lock()
+	if c.nick != "" {
+		delete(d.clients, c.nick)
+	}
+	var chans []*ircdChannel
+	for _, ch := range d.channels {
+		if _, ok := ch.members[c.nick]; ok {
+			delete(ch.members, c.nick)
+			chans = append(chans, ch)
+		}
+	}
+	d.mu.Unlock()
+	for _, ch := range chans {
+		d.broadcast(ch, fmt.Sprintf(":%s QUIT :%s", c.prefix(), reason), c)
+	}
+	c.conn.Close()
+}
+
+// runStandalone hosts the embedded ircd on ircPort instead of dialing
+// out to an external network, and serves the announcement API directly
+// against its in-memory channel state.
+func runStandalone(pw passwd, routes map[string]conferenceRoute, backendNames []string, track *conferenceTracker) {
+	certPath, keyPath := ircdCertPath, ircdKeyPath
+	if certPath == "" || keyPath == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			log.Fatalf("os.UserHomeDir: %v", err)
+		}
+		if certPath == "" {
+			certPath = path.Join(home, confDir, "ircd.crt")
+		}
+		if keyPath == "" {
+			keyPath = path.Join(home, confDir, "ircd.key")
+		}
+	}
+	cert, err := tls.LoadX509KeyPair(certPath, keyPath)
+	if err != nil {
+		log.Fatalf("tls.LoadX509KeyPair: %v", err)
+	}
+	tlsConfig := &tls.Config{Certificates: []tls.Certificate{cert}}
+
+	d := newIRCD(ircServer)
+	go func() {
+		if err := d.listenAndServeTLS(":"+ircPort, tlsConfig); err != nil {
+			log.Fatalf("ircd: %v", err)
+		}
+	}()
+
+	backends, err := buildBackends(backendNames, d)
+	if err != nil {
+		log.Fatalf("buildBackends: %v", err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/legacy", wrapLegacyAPIHandler(d, pw))
+	mux.HandleFunc("/v1/event", wrapEventAPIHandler(backends, pw, routes, track))
+	srv := &http.Server{
+		Addr:    ":" + port,
+		Handler: mux,
+	}
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt)
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- srv.ListenAndServe()
+	}()
+
+	select {
+	case <-sigs:
+		log.Print("** interrupt **")
+	case err := <-errCh:
+		log.Printf("api server error: %v", err)
+	}
+
+	log.Print("shutting down HTTP server")
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	srv.Shutdown(ctx)
+	os.Exit(0)
+}
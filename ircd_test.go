@@ -0,0 +1,58 @@
+package main
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"testing"
+)
+
+func newTestClient(t *testing.T) (*ircdClient, *bufio.Reader) {
+	t.Helper()
+	server, client := net.Pipe()
+	t.Cleanup(func() { server.Close(); client.Close() })
+	return &ircdClient{conn: server}, bufio.NewReader(client)
+}
+
+func readLine(t *testing.T, r *bufio.Reader) string {
+	t.Helper()
+	line, err := r.ReadString('\n')
+	if err != nil {
+		t.Fatalf("ReadString: %v", err)
+	}
+	return strings.TrimRight(line, "\r\n")
+}
+
+func TestDispatchRejectsUnregisteredJoin(t *testing.T) {
+	d := newIRCD("confann.test")
+	c, r := newTestClient(t)
+
+	go d.dispatch(c, "JOIN #a")
+	line := readLine(t, r)
+	if !strings.Contains(line, " "+errNotRegistered+" ") {
+		t.Fatalf("expected %s reply, got %q", errNotRegistered, line)
+	}
+	if _, ok := d.channels["#a"]; ok {
+		t.Fatalf("JOIN from an unregistered client must not create the channel")
+	}
+}
+
+func TestHandleNickRejectsCollision(t *testing.T) {
+	d := newIRCD("confann.test")
+	first, _ := newTestClient(t)
+	second, r2 := newTestClient(t)
+
+	d.handleNick(first, []string{"alice"})
+	go d.handleNick(second, []string{"alice"})
+
+	line := readLine(t, r2)
+	if !strings.Contains(line, " "+errNicknameInUse+" ") {
+		t.Fatalf("expected %s reply, got %q", errNicknameInUse, line)
+	}
+	if second.nick != "" {
+		t.Fatalf("second client's nick should be left unset, got %q", second.nick)
+	}
+	if d.clients["alice"] != first {
+		t.Fatalf("first client should still own the nick")
+	}
+}
@@ -27,31 +27,83 @@ import (
 	"os"
 	"os/signal"
 	"path"
+	"runtime"
 	"strings"
+	"sync"
 	"time"
 
 	irc "github.com/fluffle/goirc/client"
-	"golang.org/x/crypto/bcrypt"
 )
 
 const botMessage = `confann by alrs@tilde.team answers to "!botlist", and "!botlist" alone.`
 const confDir = ".confann"
 
-var ircReady bool
-
 type passwd struct {
 	User string
 	Hash string
 }
 
 var channel, ircServer, ircPort, port string
+var useSASL bool
+var standalone bool
+var ircdCertPath, ircdKeyPath string
+var backendsFlag string
+var matrixHomeserver string
 
 func init() {
 	flag.StringVar(&channel, "channel", "#alrs", "IRC channel")
 	flag.StringVar(&ircServer, "server", "tilde.chat", "IRC server")
 	flag.StringVar(&ircPort, "ircPort", "6697", "IRC port")
 	flag.StringVar(&port, "apiPort", "8080", "API port")
-	flag.Parse()
+	flag.BoolVar(&useSASL, "sasl", false, "authenticate with SASL PLAIN instead of NickServ IDENTIFY")
+	flag.BoolVar(&standalone, "standalone", false, "host an embedded mini-IRCd on ircPort instead of connecting outward")
+	flag.StringVar(&ircdCertPath, "ircdCert", "", "TLS certificate for -standalone mode (default ~/.confann/ircd.crt)")
+	flag.StringVar(&ircdKeyPath, "ircdKey", "", "TLS key for -standalone mode (default ~/.confann/ircd.key)")
+	flag.StringVar(&backendsFlag, "backends", "irc", "comma-separated list of active notification backends (irc,matrix,slack)")
+	flag.StringVar(&matrixHomeserver, "matrixHomeserver", "https://matrix.org", "Matrix homeserver base URL for the matrix backend")
+}
+
+// connHolder holds the *irc.Conn currently in use, since it's replaced
+// wholesale on every reconnect, plus whether that connection is
+// currently usable. It's the Notifier implementation backing the "irc"
+// backend.
+type connHolder struct {
+	mu    sync.RWMutex
+	conn  *irc.Conn
+	ready bool
+}
+
+func (h *connHolder) setConn(c *irc.Conn) {
+	h.mu.Lock()
+	h.conn = c
+	h.mu.Unlock()
+}
+
+func (h *connHolder) getConn() *irc.Conn {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.conn
+}
+
+func (h *connHolder) setReady(v bool) {
+	h.mu.Lock()
+	h.ready = v
+	h.mu.Unlock()
+}
+
+func (h *connHolder) Ready() bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.ready
+}
+
+func (h *connHolder) Notify(ctx context.Context, channel, msg string) error {
+	conn := h.getConn()
+	if conn == nil {
+		return fmt.Errorf("irc not connected")
+	}
+	conn.Notice(channel, msg)
+	return nil
 }
 
 func parsePasswd(data []byte) (passwd, error) {
@@ -111,17 +163,22 @@ func buildIRCConfig() (*irc.Config, error) {
 	cfg.SSL = true
 	cfg.SSLConfig = &tls.Config{ServerName: ircServer}
 	cfg.Flood = false
+	cfg.Version = "confann " + confannVersion + " (" + runtime.Version() + ")"
 	return cfg, nil
 }
 
-func defineHandlers(conn *irc.Conn, pw string) map[string]chan struct{} {
+// defineHandlers wires up the per-connection event, CTCP, and command
+// handlers. onRegister is invoked when REGISTER fires, and is where
+// NickServ IDENTIFY happens; it's a no-op when authenticating via SASL,
+// since that handshake completes before RPL_WELCOME.
+func defineHandlers(conn *irc.Conn, onRegister func(conn *irc.Conn), track *conferenceTracker) map[string]chan struct{} {
 	handlerChans := make(map[string]chan struct{})
 	handlerChans["connected"] = make(chan struct{})
-	handlerChans["disconnect"] = make(chan struct{})
+	handlerChans["disconnected"] = make(chan struct{})
 
 	conn.HandleFunc("connected",
 		func(con *irc.Conn, line *irc.Line) {
-			handlerChans["connected"] <- struct{}{}
+			close(handlerChans["connected"])
 		})
 
 	conn.HandleFunc("disconnected",
@@ -130,86 +187,112 @@ func defineHandlers(conn *irc.Conn, pw string) map[string]chan struct{} {
 		})
 
 	conn.HandleFunc(irc.PRIVMSG, func(conn *irc.Conn, line *irc.Line) {
-		if len(line.Args) >= 2 && line.Args[1] == "!botlist" {
-			conn.Privmsg(line.Args[0], botMessage)
-			log.Print(line.Raw)
-		}
+		dispatchCommand(conn, track, line)
+	})
+
+	conn.HandleFunc(irc.CTCP, func(conn *irc.Conn, line *irc.Line) {
+		handleCTCP(conn, line)
 	})
 
 	conn.HandleFunc(irc.REGISTER, func(conn *irc.Conn, line *irc.Line) {
 		log.Print("received REGISTER")
-		conn.Privmsg("NickServ", identString(pw))
+		onRegister(conn)
 	})
 
 	return handlerChans
 }
 
-func wrapAPIHandler(conn *irc.Conn, pw passwd) func(w http.ResponseWriter, r *http.Request) {
-	return func(w http.ResponseWriter, r *http.Request) {
-
-		// from Asterisk dialplan:
-		// exten => 1000,1,Set(CURLOPT(userpwd)=some_username:some_password)
-		// exten => 1000,n,NoOp(${CURL(https://confann.example.org/,CLID=${CALLERID(num)}})
-		// exten => 1000,n,ConfBridge("someconference")
-
-		u, p, authPresent := r.BasicAuth()
-		if !authPresent || u != pw.User {
-			log.Printf("401: %s", r.URL.RequestURI())
-			http.Error(w, "401", http.StatusUnauthorized)
-			return
-		}
-		cryptRes := bcrypt.CompareHashAndPassword([]byte(pw.Hash), []byte(p))
-		if cryptRes != nil {
-			log.Printf("401: %s %v", r.URL.RequestURI(), cryptRes)
-			http.Error(w, "401", http.StatusUnauthorized)
+// runConnection dials the IRC server and stays connected, reconnecting
+// with exponential backoff and jitter whenever the connection drops,
+// until stop is closed.
+func runConnection(holder *connHolder, cfg *irc.Config, track *conferenceTracker, preConnect, onRegister func(conn *irc.Conn), stop <-chan struct{}) {
+	attempt := 0
+	for {
+		select {
+		case <-stop:
 			return
+		default:
 		}
 
-		if r.Method != "POST" {
-			log.Printf("404: %s", r.URL.RequestURI())
-			http.Error(w, "404", http.StatusNotFound)
-			return
+		conn := irc.Client(cfg)
+		conn.EnableStateTracking()
+		preConnect(conn)
+		handlerChans := defineHandlers(conn, onRegister, track)
+
+		if err := conn.ConnectTo(cfg.Server); err != nil {
+			log.Printf("ConnectTo: %v", err)
+			delay := backoffDelay(attempt)
+			attempt++
+			log.Printf("reconnecting in %s", delay)
+			select {
+			case <-time.After(delay):
+				continue
+			case <-stop:
+				return
+			}
 		}
-		err := r.ParseForm()
-		if err != nil {
-			log.Printf("error parsing request form: %v", err)
-			http.Error(w, "400", http.StatusBadRequest)
+		log.Printf("DIAL: %s", serverString())
+		holder.setConn(conn)
+
+		select {
+		case <-handlerChans["connected"]:
+			attempt = 0
+			holder.setReady(true)
+			log.Print("irc connected")
+			// tilde.chat requires join to bots
+			conn.Join("#bots")
+			log.Printf("joining %s", channel)
+			conn.Join(channel)
+		case <-handlerChans["disconnected"]:
+			log.Print("irc disconnected before registration completed")
+		case <-stop:
+			conn.Close()
 			return
 		}
-		var post []string
-		var clid string
-		var ok bool
-		if post, ok = r.PostForm["CLID"]; ok {
-			log.Printf("API: %v from %s", post, r.RemoteAddr)
-			if len(post) > 0 {
-				clid = post[0]
-			} else {
-				clid = "<< anonymous caller >>"
-			}
-		} else {
-			log.Printf("API: insufficient PostForm: %v", r.PostForm)
-			http.Error(w, "400", http.StatusBadRequest)
+
+		select {
+		case <-handlerChans["disconnected"]:
+			holder.setReady(false)
+			log.Print("irc disconnected")
+		case <-stop:
+			conn.Close()
 			return
 		}
-		notice := fmt.Sprintf("%s joined the conference.", clid)
 
-		if !ircReady {
-			log.Print("API: irc not connected yet")
-			http.Error(w, "503: irc disconnected", http.StatusServiceUnavailable)
+		delay := backoffDelay(attempt)
+		attempt++
+		log.Printf("reconnecting in %s", delay)
+		select {
+		case <-time.After(delay):
+		case <-stop:
 			return
 		}
-		conn.Notice(channel, notice)
 	}
 }
 
 func main() {
-	quit := make(chan struct{}, 1)
+	flag.Parse()
+
 	sigs := make(chan os.Signal, 1)
 	signal.Notify(sigs, os.Interrupt)
 
-	nickservPW, err := loadNickservPW()
+	pw, err := loadPasswd()
+	if err != nil {
+		log.Fatalf("loadPasswd: %v", err)
+	}
+
+	backendNames := parseBackendList(backendsFlag)
+
+	routes, err := loadConferences(backendNames)
 	if err != nil {
-		log.Fatalf("loadNickservPW: %v", err)
+		log.Fatalf("loadConferences: %v", err)
+	}
+
+	track := newConferenceTracker()
+
+	if standalone {
+		runStandalone(pw, routes, backendNames, track)
+		return
 	}
 
 	cfg, err := buildIRCConfig()
@@ -217,58 +300,61 @@ func main() {
 		log.Fatalf("buildIRCConfig: %v", err)
 	}
 
-	pw, err := loadPasswd()
-	if err != nil {
-		log.Fatalf("loadPasswd: %v", err)
+	var preConnect func(conn *irc.Conn)
+	var onRegister func(conn *irc.Conn)
+	if useSASL {
+		creds, err := loadSASLSecret()
+		if err != nil {
+			log.Fatalf("loadSASLSecret: %v", err)
+		}
+		configureSASL(cfg, creds)
+		preConnect = func(conn *irc.Conn) { registerSASLLogging(conn) }
+		onRegister = func(conn *irc.Conn) {}
+	} else {
+		nickservPW, err := loadNickservPW()
+		if err != nil {
+			log.Fatalf("loadNickservPW: %v", err)
+		}
+		preConnect = func(conn *irc.Conn) {}
+		onRegister = func(conn *irc.Conn) {
+			conn.Privmsg("NickServ", identString(nickservPW))
+		}
 	}
 
-	conn := irc.Client(cfg)
-	//	conn.EnableStateTracking()
-	handlerChans := defineHandlers(conn, nickservPW)
+	holder := &connHolder{}
+	stop := make(chan struct{})
+
+	go runConnection(holder, cfg, track, preConnect, onRegister, stop)
 
-	if err := conn.ConnectTo(cfg.Server); err != nil {
-		log.Fatalf("ConnectTo: %v", err)
+	backends, err := buildBackends(backendNames, holder)
+	if err != nil {
+		log.Fatalf("buildBackends: %v", err)
 	}
-	log.Printf("DIAL: %s", serverString())
 
-	handler := wrapAPIHandler(conn, pw)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/legacy", wrapLegacyAPIHandler(holder, pw))
+	mux.HandleFunc("/v1/event", wrapEventAPIHandler(backends, pw, routes, track))
 	srv := &http.Server{
-		Addr: ":" + port,
+		Addr:    ":" + port,
+		Handler: mux,
 	}
 	errCh := make(chan error, 1)
 	go func() {
-		http.HandleFunc("/", handler)
 		errCh <- srv.ListenAndServe()
 	}()
 
+	select {
+	case <-sigs:
+		log.Print("** interrupt **")
+	case err := <-errCh:
+		log.Printf("api server error: %v", err)
+	}
+
+	log.Print("closing IRC connection")
+	close(stop)
+	log.Print("shutting down HTTP server")
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
 	defer cancel()
-
-	for {
-		select {
-		case <-quit:
-			log.Print("closing IRC connection")
-			conn.Close()
-			log.Print("shutting down HTTP server")
-			srv.Shutdown(ctx)
-			os.Exit(0)
-		case <-sigs:
-			log.Print("** interrupt **")
-			quit <- struct{}{}
-		case <-handlerChans["connected"]:
-			ircReady = true
-			log.Print("irc connected")
-			// tilde.chat requires join to bots
-			conn.Join("#bots")
-			log.Printf("joining %s", channel)
-			conn.Join(channel)
-		case <-handlerChans["disconnected"]:
-			ircReady = false
-			log.Print("irc disconnected")
-			quit <- struct{}{}
-		case err := <-errCh:
-			log.Printf("api server error: %v", err)
-			quit <- struct{}{}
-		}
-	}
+	srv.Shutdown(ctx)
+	os.Exit(0)
 }
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// matrixNotifier posts m.room.message events to a Matrix homeserver's
+// client-server API, authenticating with an access token loaded from
+// ~/.confann/matrix.secret. The "channel" argument to Notify is the
+// Matrix room ID conferences are configured to announce into.
+type matrixNotifier struct {
+	homeserver  string
+	accessToken string
+	client      *http.Client
+	txnID       uint64
+}
+
+func loadMatrixSecret() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	fqp := path.Join(home, confDir, "matrix.secret")
+	data, err := ioutil.ReadFile(fqp)
+	if err != nil {
+		return "", err
+	}
+	token := strings.TrimSuffix(string(data), "\n")
+	if token == "" {
+		return "", fmt.Errorf("empty matrix secret")
+	}
+	return token, nil
+}
+
+func newMatrixNotifier(homeserver, accessToken string) *matrixNotifier {
+	return &matrixNotifier{
+		homeserver:  strings.TrimSuffix(homeserver, "/"),
+		accessToken: accessToken,
+		client:      &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (m *matrixNotifier) Ready() bool {
+	return m.accessToken != ""
+}
+
+type matrixMessage struct {
+	MsgType string `json:"msgtype"`
+	Body    string `json:"body"`
+}
+
+func (m *matrixNotifier) Notify(ctx context.Context, roomID, msg string) error {
+	txn := atomic.AddUint64(&m.txnID, 1)
+	u := fmt.Sprintf("%s/_matrix/client/v3/rooms/%s/send/m.room.message/confann-%d",
+		m.homeserver, url.PathEscape(roomID), txn)
+
+	body, err := json.Marshal(matrixMessage{MsgType: "m.text", Body: msg})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, u, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+m.accessToken)
+
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("matrix: %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,11 @@
+package main
+
+import "context"
+
+// Notifier delivers an announcement to a channel/room on some backend
+// -- the live goirc connection, the embedded -standalone ircd, Matrix,
+// a Slack webhook, or anything else wired in via -backends.
+type Notifier interface {
+	Notify(ctx context.Context, channel, msg string) error
+	Ready() bool
+}
@@ -0,0 +1,46 @@
+package main
+
+import "testing"
+
+func TestParseSASLSecret(t *testing.T) {
+	c, err := parseSASLSecret([]byte("alice:hunter2\n"))
+	if err != nil {
+		t.Fatalf("parseSASLSecret: %v", err)
+	}
+	if c.Account != "alice" || c.Password != "hunter2" {
+		t.Fatalf("got %+v, want alice:hunter2", c)
+	}
+}
+
+func TestParseSASLSecretRejectsMissingSeparator(t *testing.T) {
+	if _, err := parseSASLSecret([]byte("nocolonhere")); err == nil {
+		t.Fatal("expected an error for a secret with no separator")
+	}
+}
+
+// TestConfigureSASLHandshake calls Start on cfg.Sasl to check that
+// configureSASL produces a PLAIN mechanism whose initial response is the
+// RFC 4616 authzid\0authcid\0passwd payload goirc will send in
+// AUTHENTICATE.
+func TestConfigureSASLHandshake(t *testing.T) {
+	cfg, err := buildIRCConfig()
+	if err != nil {
+		t.Fatalf("buildIRCConfig: %v", err)
+	}
+	configureSASL(cfg, saslCreds{Account: "alice", Password: "hunter2"})
+	if cfg.Sasl == nil {
+		t.Fatal("configureSASL left cfg.Sasl nil")
+	}
+
+	mech, ir, err := cfg.Sasl.Start()
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	if mech != "PLAIN" {
+		t.Fatalf("mechanism = %q, want PLAIN", mech)
+	}
+	want := "\x00alice\x00hunter2"
+	if string(ir) != want {
+		t.Fatalf("initial response = %q, want %q", ir, want)
+	}
+}
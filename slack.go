@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// slackNotifier posts to a Slack-compatible incoming webhook, with the
+// URL loaded from ~/.confann/slack.secret. Channel is included in the
+// payload for completeness, but classic Slack incoming webhooks are
+// bound to a single channel at creation time and ignore it.
+type slackNotifier struct {
+	webhookURL string
+	client     *http.Client
+}
+
+func loadSlackWebhookURL() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	fqp := path.Join(home, confDir, "slack.secret")
+	data, err := ioutil.ReadFile(fqp)
+	if err != nil {
+		return "", err
+	}
+	webhookURL := strings.TrimSuffix(string(data), "\n")
+	if webhookURL == "" {
+		return "", fmt.Errorf("empty slack webhook url")
+	}
+	return webhookURL, nil
+}
+
+func newSlackNotifier(webhookURL string) *slackNotifier {
+	return &slackNotifier{webhookURL: webhookURL, client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+func (s *slackNotifier) Ready() bool {
+	return s.webhookURL != ""
+}
+
+type slackPayload struct {
+	Channel string `json:"channel,omitempty"`
+	Text    string `json:"text"`
+}
+
+func (s *slackNotifier) Notify(ctx context.Context, channel, msg string) error {
+	body, err := json.Marshal(slackPayload{Channel: channel, Text: msg})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.webhookURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("slack webhook: %s", resp.Status)
+	}
+	return nil
+}
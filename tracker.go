@@ -0,0 +1,86 @@
+package main
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// conferenceTracker holds in-memory, best-effort state about active
+// conference bridges, built up from the join/leave events the /v1/event
+// API receives. It backs the !conferences/!who/!silence commands.
+type conferenceTracker struct {
+	mu        sync.Mutex
+	occupants map[string]map[string]time.Time // conference -> clid -> joined at
+	silenced  map[string]time.Time            // conference -> silenced until
+}
+
+func newConferenceTracker() *conferenceTracker {
+	return &conferenceTracker{
+		occupants: make(map[string]map[string]time.Time),
+		silenced:  make(map[string]time.Time),
+	}
+}
+
+// apply updates occupancy for a join/leave event. Other event types
+// (mute, unmute, talking) don't affect occupancy.
+func (t *conferenceTracker) apply(ev confEvent) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	switch ev.Event {
+	case "join":
+		if t.occupants[ev.Conference] == nil {
+			t.occupants[ev.Conference] = make(map[string]time.Time)
+		}
+		t.occupants[ev.Conference][ev.CLID] = ev.Timestamp
+	case "leave":
+		delete(t.occupants[ev.Conference], ev.CLID)
+	}
+}
+
+// conferences returns the names of conferences with at least one
+// occupant, sorted for stable !conferences output.
+func (t *conferenceTracker) conferences() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	names := make([]string, 0, len(t.occupants))
+	for name, occ := range t.occupants {
+		if len(occ) > 0 {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (t *conferenceTracker) occupantCount(conference string) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.occupants[conference])
+}
+
+// occupantCLIDs returns the CLIDs currently in conference, sorted.
+func (t *conferenceTracker) occupantCLIDs(conference string) []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	clids := make([]string, 0, len(t.occupants[conference]))
+	for clid := range t.occupants[conference] {
+		clids = append(clids, clid)
+	}
+	sort.Strings(clids)
+	return clids
+}
+
+// silence suppresses announcements for conference for d.
+func (t *conferenceTracker) silence(conference string, d time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.silenced[conference] = time.Now().Add(d)
+}
+
+func (t *conferenceTracker) isSilenced(conference string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	until, ok := t.silenced[conference]
+	return ok && time.Now().Before(until)
+}